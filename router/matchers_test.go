@@ -0,0 +1,114 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveWithHost(rt *Router, method, path, host string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Host = host
+	rt.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHostMatch(t *testing.T) {
+
+	var got string
+
+	rt := New(Options{})
+	g := rt.Group("", nil, nil)
+	g.Host("api.:tenant.example.com")
+	g.Get("/ping", func(w http.ResponseWriter, r *Request) {
+		got = "tenant:" + r.Vars["tenant"]
+	})
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("unexpected errors registering routes: %v", rt.Errors)
+	}
+
+	serveWithHost(rt, "GET", "/ping", "api.acme.example.com")
+	if got != "tenant:acme" {
+		t.Errorf("got %q, want %q", got, "tenant:acme")
+	}
+
+	got = ""
+	serveWithHost(rt, "GET", "/ping", "api.example.com")
+	if got != "" {
+		t.Errorf("got %q, want no match for a Host that doesn't fit the pattern", got)
+	}
+}
+
+func TestHostConflictDetected(t *testing.T) {
+	rt := New(Options{})
+	g1 := rt.Group("/admin", nil, nil)
+	g1.Host("admin.example.com")
+	g2 := rt.Group("/admin", nil, nil)
+	g2.Host("admin.other.com")
+
+	if len(rt.Errors) == 0 {
+		t.Fatal("expected an error for two different Host patterns registered on the same grouping, got none")
+	}
+}
+
+func TestSchemesMatch(t *testing.T) {
+
+	var called bool
+
+	rt := New(Options{})
+	g := rt.Group("/secure", nil, nil)
+	g.Schemes("https")
+	g.Get("/data", func(w http.ResponseWriter, r *Request) {
+		called = true
+	})
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("unexpected errors registering routes: %v", rt.Errors)
+	}
+
+	serve(rt, "GET", "/secure/data")
+	if called {
+		t.Error("handler ran for a plain http request despite Schemes(\"https\")")
+	}
+
+	called = false
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/secure/data", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rt.ServeHTTP(rec, req)
+	if !called {
+		t.Error("handler did not run for a request forwarded as https")
+	}
+}
+
+func TestHeadersMatch(t *testing.T) {
+
+	var called bool
+
+	rt := New(Options{})
+	g := rt.Group("/internal", nil, nil)
+	g.Headers("X-Internal-Token", "secret")
+	g.Get("/ping", func(w http.ResponseWriter, r *Request) {
+		called = true
+	})
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("unexpected errors registering routes: %v", rt.Errors)
+	}
+
+	serve(rt, "GET", "/internal/ping")
+	if called {
+		t.Error("handler ran for a request missing the required header")
+	}
+
+	called = false
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/internal/ping", nil)
+	req.Header.Set("X-Internal-Token", "secret")
+	rt.ServeHTTP(rec, req)
+	if !called {
+		t.Error("handler did not run for a request carrying the required header")
+	}
+}
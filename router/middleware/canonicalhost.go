@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+/*
+CanonicalHost returns a Handler, for use with route.Use, that
+redirects any request whose Host differs from host to the same
+path and query on host, using the given status code (typically
+http.StatusMovedPermanently or http.StatusPermanentRedirect).
+
+Setting r.Status within the 3xx range is enough to terminate the
+request at this point; the router's dispatcher treats a Use
+handler doing so the same way it treats Before redirecting.
+*/
+func CanonicalHost(host string, code int) router.Handler {
+	return func(w http.ResponseWriter, r *router.Request) {
+		if r.Request.Host == host {
+			return
+		}
+		u := *r.Request.URL
+		u.Scheme = schemeOf(r.Request)
+		u.Host = host
+		w.Header().Set("Location", u.String())
+		w.WriteHeader(code)
+		r.Status = code
+	}
+}
+
+func schemeOf(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if scheme := r.Header.Get("X-Forwarded-Proto"); scheme != "" {
+		return scheme
+	}
+	return "http"
+}
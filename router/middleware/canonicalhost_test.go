@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+func TestCanonicalHostRedirects(t *testing.T) {
+
+	handlerCalled := false
+	rt := router.New(router.Options{})
+	rt.Get("/page", func(w http.ResponseWriter, r *router.Request) {
+		handlerCalled = true
+	}).Use(CanonicalHost("www.example.com", http.StatusMovedPermanently))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/page?x=1", nil)
+	req.Host = "example.com"
+	rt.ServeHTTP(rec, req)
+
+	if handlerCalled {
+		t.Error("handler ran despite the request being redirected to the canonical host")
+	}
+	if rec.Code != http.StatusMovedPermanently {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusMovedPermanently)
+	}
+	want := "http://www.example.com/page?x=1"
+	if got := rec.Header().Get("Location"); got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+}
+
+func TestCanonicalHostPassesThroughAlreadyCanonical(t *testing.T) {
+
+	handlerCalled := false
+	rt := router.New(router.Options{})
+	rt.Get("/page", func(w http.ResponseWriter, r *router.Request) {
+		handlerCalled = true
+		w.WriteHeader(http.StatusOK)
+	}).Use(CanonicalHost("www.example.com", http.StatusMovedPermanently))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/page", nil)
+	req.Host = "www.example.com"
+	rt.ServeHTTP(rec, req)
+
+	if !handlerCalled {
+		t.Error("handler did not run for a request already on the canonical host")
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+/*
+CORSOptions configures CORS. AllowedOrigins is matched against
+the Origin header exactly, unless it contains the single entry
+"*", or AllowedOriginPattern is set, in which case that takes
+precedence. AllowedMethods defaults to GET, POST, PUT, PATCH
+and DELETE when left empty; an empty AllowedHeaders echoes back
+whatever the preflight's Access-Control-Request-Headers lists.
+*/
+type CORSOptions struct {
+	AllowedOrigins       []string
+	AllowedOriginPattern *regexp.Regexp
+	AllowedMethods       []string
+	AllowedHeaders       []string
+	AllowCredentials     bool
+	MaxAge               int // seconds; 0 omits Access-Control-Max-Age
+}
+
+/*
+CORS returns a Handler, for use with route.Use, that answers
+CORS preflight requests and annotates actual ones with the
+appropriate Access-Control-* headers according to opts.
+
+A preflight OPTIONS request that is allowed is answered here
+directly: Status is set to 204 so the router's dispatcher treats
+the request as already handled and never reaches a route's own
+handler.
+*/
+func CORS(opts CORSOptions) router.Handler {
+	return func(w http.ResponseWriter, r *router.Request) {
+
+		origin := r.Request.Header.Get("Origin")
+		if origin == "" || !originAllowed(opts, origin) {
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		if opts.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Request.Method != http.MethodOptions ||
+			r.Request.Header.Get("Access-Control-Request-Method") == "" {
+			return
+		}
+
+		methods := opts.AllowedMethods
+		if len(methods) == 0 {
+			methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+		headers := opts.AllowedHeaders
+		if len(headers) == 0 {
+			if reqHeaders := r.Request.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+				headers = []string{reqHeaders}
+			}
+		}
+		if len(headers) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		}
+
+		if opts.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(opts.MaxAge))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		r.Status = http.StatusNoContent
+	}
+}
+
+func originAllowed(opts CORSOptions, origin string) bool {
+	if opts.AllowedOriginPattern != nil {
+		return opts.AllowedOriginPattern.MatchString(origin)
+	}
+	for _, allowed := range opts.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+func TestCORSAnnotatesActualRequest(t *testing.T) {
+	rt := router.New(router.Options{})
+	rt.Get("/data", func(w http.ResponseWriter, r *router.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Use(CORS(CORSOptions{AllowedOrigins: []string{"https://example.com"}}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/data", nil)
+	req.Header.Set("Origin", "https://example.com")
+	rt.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, "https://example.com")
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d: an actual request must still reach the handler", rec.Code, http.StatusOK)
+	}
+}
+
+func TestCORSRejectsDisallowedOrigin(t *testing.T) {
+	rt := router.New(router.Options{})
+	rt.Get("/data", func(w http.ResponseWriter, r *router.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Use(CORS(CORSOptions{AllowedOrigins: []string{"https://example.com"}}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/data", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	rt.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want unset for a disallowed origin", got)
+	}
+}
+
+func TestCORSAnswersPreflight(t *testing.T) {
+
+	handlerCalled := false
+	rt := router.New(router.Options{})
+	rt.Opt("/data", func(w http.ResponseWriter, r *router.Request) {
+		handlerCalled = true
+	}).Use(CORS(CORSOptions{AllowedOrigins: []string{"*"}}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("OPTIONS", "/data", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rt.ServeHTTP(rec, req)
+
+	if handlerCalled {
+		t.Error("a preflight request must be answered by CORS and never reach the route's own handler")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got == "" {
+		t.Error("Access-Control-Allow-Methods was not set on a preflight response")
+	}
+}
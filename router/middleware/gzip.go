@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+// compressedTypes are Content-Types not worth gzipping again.
+var compressedTypes = []string{
+	"image/", "video/", "audio/",
+	"application/zip", "application/gzip", "application/font",
+}
+
+/*
+Gzip returns a Handler, for use with route.Use, that compresses
+the response body with gzip at level (see compress/gzip's level
+constants) whenever the client sends an Accept-Encoding header
+containing "gzip". gzip.Writer values are pooled to avoid an
+allocation per request.
+
+Since Use runs before the route's handler, Content-Type is
+typically still unset at this point, so the decision of whether
+to compress is made from *router.ResponseWriter.OnWriteHeader
+instead, which ServeHTTP always supplies and which doesn't run
+until the handler has had a chance to set Content-Type. Content-
+Encoding, Vary, and the removal of any Content-Length the handler
+set are applied at that same moment, and the gzip.Writer is
+installed via Wrap so it wraps whatever a middleware registered
+after Gzip has already wrapped Writer() with, rather than
+discarding it. Close on whatever ends up installed (called
+automatically once request processing ends) returns the
+gzip.Writer, if one was used, to the pool.
+*/
+func Gzip(level int) router.Handler {
+
+	pool := &sync.Pool{
+		New: func() interface{} {
+			zw, err := gzip.NewWriterLevel(nil, level)
+			if err != nil {
+				zw, _ = gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+			}
+			return zw
+		},
+	}
+
+	return func(w http.ResponseWriter, r *router.Request) {
+
+		if !strings.Contains(r.Request.Header.Get("Accept-Encoding"), "gzip") {
+			return
+		}
+		rw, ok := w.(*router.ResponseWriter)
+		if !ok {
+			return
+		}
+
+		rw.OnWriteHeader(func(status int) {
+			if isCompressed(rw.Header().Get("Content-Type")) {
+				return
+			}
+			zw := pool.Get().(*gzip.Writer)
+			zw.Reset(rw.Writer())
+			rw.Wrap(&pooledGzipWriter{zw: zw, underlying: rw.Writer(), pool: pool})
+			rw.Header().Set("Content-Encoding", "gzip")
+			rw.Header().Add("Vary", "Accept-Encoding")
+			rw.Header().Del("Content-Length")
+		})
+	}
+}
+
+/*
+pooledGzipWriter writes through zw, the compressor, rather than
+underlying directly. Close returns zw to pool and, since it may
+have displaced a writer installed by another middleware (e.g.
+Timeout's cancel-on-close wrapper), also closes underlying if it
+is itself an io.Closer, so that wrapper's own cleanup still runs.
+*/
+type pooledGzipWriter struct {
+	zw         *gzip.Writer
+	underlying io.Writer
+	pool       *sync.Pool
+}
+
+func (p *pooledGzipWriter) Write(b []byte) (int, error) {
+	return p.zw.Write(b)
+}
+
+func (p *pooledGzipWriter) Close() error {
+	err := p.zw.Close()
+	p.pool.Put(p.zw)
+	if c, ok := p.underlying.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func isCompressed(contentType string) bool {
+	for _, prefix := range compressedTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
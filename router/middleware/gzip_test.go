@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+func TestGzipCompressesWhenAccepted(t *testing.T) {
+
+	rt := router.New(router.Options{})
+	rt.Get("/text", func(w http.ResponseWriter, r *router.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "12")
+		w.Write([]byte("hello, world"))
+	}).Use(Gzip(gzip.DefaultCompression))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/text", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rt.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want %q", got, "gzip")
+	}
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Content-Length = %q, want the handler's value removed since it no longer matches the compressed body", got)
+	}
+
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("response body is not valid gzip: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading gzip body: %v", err)
+	}
+	if string(body) != "hello, world" {
+		t.Errorf("decompressed body = %q, want %q", body, "hello, world")
+	}
+}
+
+func TestGzipSkipsAlreadyCompressedContentType(t *testing.T) {
+
+	rt := router.New(router.Options{})
+	rt.Get("/image", func(w http.ResponseWriter, r *router.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("not-really-a-png"))
+	}).Use(Gzip(gzip.DefaultCompression))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/image", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rt.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want unset for an already-compressed type", got)
+	}
+	if got := rec.Body.String(); got != "not-really-a-png" {
+		t.Errorf("body = %q, want it written through untouched", got)
+	}
+}
+
+func TestGzipHonoursExplicitWriteHeader(t *testing.T) {
+
+	rt := router.New(router.Options{})
+	rt.Get("/text", func(w http.ResponseWriter, r *router.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}).Use(Gzip(gzip.DefaultCompression))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/text", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rt.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusCreated)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("response body is not valid gzip even though WriteHeader was called explicitly before Write: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != "created" {
+		t.Errorf("decompressed body = %q, want %q", body, "created")
+	}
+}
+
+func TestGzipComposesWithTimeout(t *testing.T) {
+
+	rt := router.New(router.Options{})
+	route := rt.Get("/both", func(w http.ResponseWriter, r *router.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("composed"))
+	})
+	route.Use(Timeout(time.Second))
+	route.Use(Gzip(gzip.DefaultCompression))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/both", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rt.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want %q: Gzip's Wrap must not be discarded by Timeout's", got, "gzip")
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("response body is not valid gzip when Timeout and Gzip are both in use: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != "composed" {
+		t.Errorf("decompressed body = %q, want %q", body, "composed")
+	}
+}
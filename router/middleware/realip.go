@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+/*
+RealIP returns a Handler, for use with route.Use, that rewrites
+r.Request.RemoteAddr from the X-Forwarded-For or X-Real-IP
+headers, but only when the current RemoteAddr falls within one
+of trusted, so that spoofed headers from untrusted peers are
+ignored. X-Forwarded-For is preferred; its left-most entry is
+used, being the one closest to the original client.
+*/
+func RealIP(trusted ...*net.IPNet) router.Handler {
+	return func(w http.ResponseWriter, r *router.Request) {
+
+		host, port, err := net.SplitHostPort(r.Request.RemoteAddr)
+		if err != nil {
+			host = r.Request.RemoteAddr
+			port = ""
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || !trustedPeer(trusted, ip) {
+			return
+		}
+
+		var forwarded string
+		if xff := r.Request.Header.Get("X-Forwarded-For"); xff != "" {
+			forwarded = strings.TrimSpace(strings.Split(xff, ",")[0])
+		} else if xri := r.Request.Header.Get("X-Real-IP"); xri != "" {
+			forwarded = strings.TrimSpace(xri)
+		}
+		if forwarded == "" || net.ParseIP(forwarded) == nil {
+			return
+		}
+
+		if port != "" {
+			r.Request.RemoteAddr = net.JoinHostPort(forwarded, port)
+		} else {
+			r.Request.RemoteAddr = forwarded
+		}
+	}
+}
+
+func trustedPeer(trusted []*net.IPNet, ip net.IP) bool {
+	for _, cidr := range trusted {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
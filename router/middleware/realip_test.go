@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+func TestRealIPRewritesFromTrustedPeer(t *testing.T) {
+
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("ParseCIDR: %v", err)
+	}
+
+	var got string
+	rt := router.New(router.Options{})
+	rt.Get("/ping", func(w http.ResponseWriter, r *router.Request) {
+		got = r.Request.RemoteAddr
+	}).Use(RealIP(trusted))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	rt.ServeHTTP(rec, req)
+
+	if got != "203.0.113.7:12345" {
+		t.Errorf("RemoteAddr = %q, want %q", got, "203.0.113.7:12345")
+	}
+}
+
+func TestRealIPIgnoresUntrustedPeer(t *testing.T) {
+
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("ParseCIDR: %v", err)
+	}
+
+	var got string
+	rt := router.New(router.Options{})
+	rt.Get("/ping", func(w http.ResponseWriter, r *router.Request) {
+		got = r.Request.RemoteAddr
+	}).Use(RealIP(trusted))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.RemoteAddr = "203.0.113.1:12345"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	rt.ServeHTTP(rec, req)
+
+	if got != "203.0.113.1:12345" {
+		t.Errorf("RemoteAddr = %q, want it untouched since the peer isn't trusted", got)
+	}
+}
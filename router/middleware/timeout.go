@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+/*
+Timeout returns a Handler, for use with route.Use, that replaces
+r.Request with one carrying a context.Context derived via
+context.WithTimeout(r.Request.Context(), d), so that a handler
+checking ctx.Done() (directly, or via anything it calls that
+honours context cancellation, e.g. database queries) gives up
+once d elapses.
+
+The returned cancel func is wired into *router.ResponseWriter's
+Close, which ServeHTTP always runs exactly once per request after
+the handler returns, so the timer is freed as soon as the request
+finishes rather than staying alive for the rest of d.
+
+Wrap is given whatever Writer currently returns rather than the
+raw underlying connection, so that Timeout composes with another
+middleware (e.g. Gzip) regardless of registration order: neither
+one's wrapper gets discarded, and Close chains through both.
+*/
+func Timeout(d time.Duration) router.Handler {
+	return func(w http.ResponseWriter, r *router.Request) {
+		ctx, cancel := context.WithTimeout(r.Request.Context(), d)
+		r.Request = r.Request.WithContext(ctx)
+		rw, ok := w.(*router.ResponseWriter)
+		if !ok {
+			// ServeHTTP always supplies a *router.ResponseWriter;
+			// this is only a defensive fallback for a handler
+			// invoked outside of it.
+			go func() {
+				<-ctx.Done()
+				cancel()
+			}()
+			return
+		}
+		rw.Wrap(&cancelOnClose{Writer: rw.Writer(), cancel: cancel})
+	}
+}
+
+// cancelOnClose releases a Timeout's context via
+// *router.ResponseWriter.Close.
+type cancelOnClose struct {
+	io.Writer
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	c.cancel()
+	if closer, ok := c.Writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
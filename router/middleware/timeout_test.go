@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jakebowkett/go-router/router"
+)
+
+func TestTimeoutContextDoneAfterRequest(t *testing.T) {
+
+	var ctx interface{ Done() <-chan struct{} }
+
+	rt := router.New(router.Options{})
+	rt.Get("/ping", func(w http.ResponseWriter, r *router.Request) {
+		ctx = r.Request.Context()
+		w.WriteHeader(http.StatusOK)
+	}).Use(Timeout(time.Minute))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/ping", nil)
+	rt.ServeHTTP(rec, req)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context was not cancelled once the request finished, well before its one-minute timeout")
+	}
+}
@@ -0,0 +1,485 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+route is the handle used to register patterns against a
+Router, either directly or within a Group. It does not
+store matching state itself; it only knows where in the
+underlying trie newly registered patterns should be
+anchored.
+*/
+type route struct {
+	rt     *Router
+	n      *node
+	method string    // set only on the handle returned by a verb method, for Name
+	full   string    // pattern accumulated from the root, for introspection
+	segs   []segment // segments accumulated from the root, for Router.URL
+}
+
+type segment struct {
+	raw      string
+	varName  string
+	matches  []string
+	re       *regexp.Regexp
+	wildcard bool
+}
+
+/*
+Use can be placed among calls to the HTTP verb methods
+without affecting matches. Since it is supplied a pointer
+to Request, one use for this method could be to attach
+a user object to the User field of *Request.
+
+If an error is encountered during the call to handler the
+error must be assigned to the supplied *Request object's
+Error field and the appropriate HTTP status code to its
+Status field.
+*/
+func (r *route) Use(handler Handler) {
+	rt := r.rt
+	if handler == nil {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"function supplied to Use is nil",
+		))
+		return
+	}
+	r.n.mw = append(r.n.mw, handler)
+}
+
+/*
+Group allows for groupings of routes.
+
+The return value of skip determines if this grouping will
+even be examined. If skip returns true the pattern matching
+check will completely skip over the grouped routes as though
+they don't exist. If skip returns false or is nil the patterns
+within the grouping will be checked as usual.
+
+The return value of unauthorized determines if the client has
+authorisation to visit this grouping. Assuming skip is nil
+or returns false, unauthorized always checks patterns for matches.
+If unauthorized returns true AND a pattern matches then the parent
+*Router Error will be called (if supplied) with the Status field
+of *Request set to 401 (i.e., Unauthorized).
+
+Two calls to Group that resolve to the same node (the same
+pattern registered from two call sites, e.g. to attach further
+routes to an existing grouping from another file) may each supply
+only one of skip/unauthorized without disturbing the other; a nil
+argument never clears a guard already set by an earlier call.
+Supplying a second guard for a field already set, even the same
+function again, is a conflict and is recorded on Errors rather
+than silently replacing the first.
+*/
+func (r *route) Group(pattern string, skip, unauthorized Guard) *route {
+	rt := r.rt
+	segs := rt.expandPattern(pattern)
+	n := rt.insert(r.n, segs, pattern)
+	if skip != nil {
+		if n.skip != nil {
+			rt.Errors = append(rt.Errors, fmt.Errorf(
+				"conflicting skip guards registered for the same grouping\npattern: %q", pattern,
+			))
+		} else {
+			n.skip = skip
+		}
+	}
+	if unauthorized != nil {
+		if n.unauthorized != nil {
+			rt.Errors = append(rt.Errors, fmt.Errorf(
+				"conflicting unauthorized guards registered for the same grouping\npattern: %q", pattern,
+			))
+		} else {
+			n.unauthorized = unauthorized
+		}
+	}
+	return &route{
+		rt:   rt,
+		n:    n,
+		full: joinPattern(r.full, pattern),
+		segs: append(append([]segment{}, r.segs...), segs...),
+	}
+}
+func (r *route) Hed(pattern string, handler Handler) *route {
+	return r.add("HEAD", pattern, handler)
+}
+func (r *route) Trc(pattern string, handler Handler) *route {
+	return r.add("TRACE", pattern, handler)
+}
+func (r *route) Con(pattern string, handler Handler) *route {
+	return r.add("CONNECT", pattern, handler)
+}
+func (r *route) Opt(pattern string, handler Handler) *route {
+	return r.add("OPTIONS", pattern, handler)
+}
+func (r *route) Get(pattern string, handler Handler) *route {
+	return r.add("GET", pattern, handler)
+}
+func (r *route) Pst(pattern string, handler Handler) *route {
+	return r.add("POST", pattern, handler)
+}
+func (r *route) Put(pattern string, handler Handler) *route {
+	return r.add("PUT", pattern, handler)
+}
+func (r *route) Pat(pattern string, handler Handler) *route {
+	return r.add("PATCH", pattern, handler)
+}
+func (r *route) Del(pattern string, handler Handler) *route {
+	return r.add("DELETE", pattern, handler)
+}
+func (r *route) add(method, pattern string, handler Handler) *route {
+
+	rt := r.rt
+
+	if handler == nil {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"no handler supplied for route %s %s",
+			method,
+			pattern,
+		))
+	}
+
+	segs := rt.expandPattern(pattern)
+	n := rt.insert(r.n, segs, pattern)
+	full := joinPattern(r.full, pattern)
+	allSegs := append(append([]segment{}, r.segs...), segs...)
+
+	if n.routes == nil {
+		n.routes = make(map[string]*routeEntry)
+	}
+	if _, ok := n.routes[method]; ok {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"unreachable route due to duplicate method and pattern: %s %s",
+			method,
+			pattern,
+		))
+	}
+	entry := &routeEntry{
+		method:  method,
+		pattern: full,
+		segs:    allSegs,
+		handler: handler,
+	}
+	n.routes[method] = entry
+	rt.entries = append(rt.entries, entry)
+
+	return &route{rt: rt, n: n, method: method, full: full, segs: allSegs}
+}
+
+/*
+Name tags the route most recently registered through r (i.e.
+the receiver returned by a call to Get, Pst, etc.) with name,
+which Router.URL can later use to reconstruct a URL for it.
+Names must be unique across the whole Router.
+*/
+func (r *route) Name(name string) *route {
+	rt := r.rt
+	if r.method == "" {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"Name called on a route that did not come from Get, Pst, etc.",
+		))
+		return r
+	}
+	if _, ok := rt.names[name]; ok {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"duplicate route name %q", name,
+		))
+		return r
+	}
+	entry := r.n.routes[r.method]
+	entry.name = name
+	if rt.names == nil {
+		rt.names = make(map[string]*routeEntry)
+	}
+	rt.names[name] = entry
+	return r
+}
+
+/*
+Host constrains r (the handle returned by Group) to requests
+whose Host header matches pattern, which is parsed like a path
+pattern except its segments are separated by "." rather than
+"/". Variables declared in pattern (e.g. ":tenant" in
+"api.:tenant.example.com") are bound into r.Vars alongside any
+path variables when a request matches.
+
+A request reaching this point in the trie whose Host does not
+match pattern falls through exactly as if the path itself hadn't
+matched, letting a sibling branch be tried instead.
+
+Host, like skip and unauthorized, constrains the node a Group
+anchors to and therefore every route registered beneath it; it
+cannot be called on the handle returned by Get, Pst, etc., since
+those share that same node with every other method registered
+against the identical pattern.
+
+As with skip and unauthorized, a second call to Host against the
+same node (e.g. the same grouping registered from two call sites)
+is a conflict and is recorded on Errors rather than silently
+replacing the pattern already set.
+*/
+func (r *route) Host(pattern string) *route {
+	rt := r.rt
+	if r.method != "" {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"Host called on a route returned by a verb method (%s %s); "+
+				"call it on the Group it belongs to instead",
+			r.method, r.full,
+		))
+		return r
+	}
+	if r.n.hostSegs != nil {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"conflicting Host patterns registered for the same grouping\npattern: %q", r.full,
+		))
+		return r
+	}
+	r.n.hostSegs = rt.expandHostPattern(pattern)
+	return r
+}
+
+/*
+Schemes constrains r to requests made over one of the given URL
+schemes (e.g. "https"), determined from Request.TLS and the
+X-Forwarded-Proto header the way CanonicalHost's redirect target
+is. A mismatch falls through like a path mismatch.
+
+As with Host, this constrains the whole node a Group anchors to
+and so cannot be called on the handle returned by a verb method.
+*/
+func (r *route) Schemes(schemes ...string) *route {
+	rt := r.rt
+	if r.method != "" {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"Schemes called on a route returned by a verb method (%s %s); "+
+				"call it on the Group it belongs to instead",
+			r.method, r.full,
+		))
+		return r
+	}
+	if r.n.schemes == nil {
+		r.n.schemes = make(map[string]bool, len(schemes))
+	}
+	for _, s := range schemes {
+		r.n.schemes[strings.ToLower(s)] = true
+	}
+	return r
+}
+
+/*
+Headers constrains r to requests carrying the given header values
+exactly, supplied as alternating key/value pairs (as with
+url.Values.Set). A request missing any of the pairs, or one of
+them, falls through like a path mismatch.
+
+As with Host, this constrains the whole node a Group anchors to
+and so cannot be called on the handle returned by a verb method.
+*/
+func (r *route) Headers(pairs ...string) *route {
+	rt := r.rt
+	if r.method != "" {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"Headers called on a route returned by a verb method (%s %s); "+
+				"call it on the Group it belongs to instead",
+			r.method, r.full,
+		))
+		return r
+	}
+	if len(pairs)%2 != 0 {
+		rt.Errors = append(rt.Errors, fmt.Errorf(
+			"Headers called with an odd number of arguments for pattern %q", r.full,
+		))
+		return r
+	}
+	if r.n.headers == nil {
+		r.n.headers = make(map[string]string, len(pairs)/2)
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		r.n.headers[pairs[i]] = pairs[i+1]
+	}
+	return r
+}
+
+/*
+joinPattern concatenates a parent and child pattern the way
+nested Groups accumulate a full path, for use in introspection
+and error messages.
+*/
+func joinPattern(parent, child string) string {
+	parent = strings.Trim(parent, "/")
+	child = strings.Trim(child, "/")
+	switch {
+	case parent == "" && child == "":
+		return "/"
+	case parent == "":
+		return "/" + child
+	case child == "":
+		return "/" + parent
+	default:
+		return "/" + parent + "/" + child
+	}
+}
+
+func (rt *Router) expandPattern(pattern string) []segment {
+	if pattern == "" {
+		return nil
+	}
+	return rt.expandSegments(pattern, explodePath(pattern))
+}
+
+/*
+expandHostPattern parses a Host pattern the same way expandPattern
+parses a path pattern, except subPatterns are split on "." rather
+than "/", so a pattern like "api.:tenant.example.com" produces a
+:tenant segment matched against the second label of the request's
+Host header.
+*/
+func (rt *Router) expandHostPattern(pattern string) []segment {
+	if pattern == "" {
+		return nil
+	}
+	return rt.expandSegments(pattern, strings.Split(pattern, "."))
+}
+
+func (rt *Router) expandSegments(pattern string, subPatterns []string) []segment {
+
+	var segments []segment
+	seenVars := make(map[string]bool)
+
+	for i, sp := range subPatterns {
+
+		var literal *string
+		var varName string
+		var matches []string
+		var re *regexp.Regexp
+		var wildcard bool
+		var listStart int
+		var errs []error
+		illegal := ":[]{}*"
+
+		switch {
+
+		// Literal segment.
+		case sp[0] != ':' && sp[0] != '[' && sp[0] != '*':
+			if idx := strings.IndexAny(sp, illegal); idx != -1 {
+				errs = append(errs, illegalChar(pattern, "literal", illegal))
+			}
+			literal = &sp
+
+		// Catch-all tail segment; must be the last in the pattern.
+		case sp[0] == '*':
+			varName = sp[1:]
+			errs = append(errs, validVarName(pattern, varName, seenVars)...)
+			seenVars[varName] = true
+			if i != len(subPatterns)-1 {
+				errs = append(errs, fmt.Errorf(
+					"catch-all segment %q must be the last segment of the pattern\npattern: %q",
+					sp, pattern))
+				break
+			}
+			wildcard = true
+
+		// Segment with a variable constrained by a regular expression.
+		case sp[0] == ':' && strings.ContainsRune(sp, '{'):
+			reStart := strings.IndexRune(sp, '{')
+			varName = sp[1:reStart]
+			errs = append(errs, validVarName(pattern, varName, seenVars)...)
+			seenVars[varName] = true
+			if sp[len(sp)-1] != '}' {
+				errs = append(errs, fmt.Errorf(
+					`pattern segment contains "{" but doesn't end with "}"`+"\n"+
+						"pattern: %q", pattern))
+				break
+			}
+			compiled, err := regexp.Compile(sp[reStart+1 : len(sp)-1])
+			if err != nil {
+				errs = append(errs, fmt.Errorf(
+					"invalid regular expression in pattern segment: %v\npattern: %q", err, pattern))
+				break
+			}
+			re = compiled
+
+		// Segement with variable.
+		case sp[0] == ':':
+			listStart = strings.IndexRune(sp, '[')
+			if listStart == -1 {
+				varName = sp[1:]
+				errs = append(errs, validVarName(pattern, varName, seenVars)...)
+				seenVars[varName] = true
+				break
+			}
+			varName = sp[1:listStart]
+			errs = append(errs, validVarName(pattern, varName, seenVars)...)
+			seenVars[varName] = true
+			fallthrough
+
+		// Segment containing whitelist.
+		case sp[0] == '[':
+			if sp[len(sp)-1] != ']' {
+				errs = append(errs, fmt.Errorf(
+					`pattern segment contains "[" but doesn't end with "]"`+"\n"+
+						"pattern: %q", pattern))
+			}
+			matches = strings.Split(sp[listStart+1:len(sp)-1], ",")
+		}
+
+		if idx := strings.IndexAny(varName, illegal); idx != -1 {
+			errs = append(errs, illegalChar(pattern, "variable", illegal))
+		}
+		for i := range matches {
+			matches[i] = strings.TrimSpace(matches[i])
+			if idx := strings.IndexAny(matches[i], illegal); idx != -1 {
+				errs = append(errs, illegalChar(pattern, "whitelist", illegal))
+			}
+		}
+
+		if literal != nil {
+			matches = []string{*literal}
+		}
+
+		if len(errs) > 0 {
+			rt.Errors = append(rt.Errors, errs...)
+			continue
+		}
+
+		segments = append(segments, segment{
+			raw:      sp,
+			varName:  varName,
+			matches:  matches,
+			re:       re,
+			wildcard: wildcard,
+		})
+	}
+
+	return segments
+}
+
+func validVarName(pattern, name string, vars map[string]bool) (errs []error) {
+	if name == "" {
+		errs = append(errs, fmt.Errorf(`no variable name after ":"\npattern: %q`, pattern))
+		return errs
+	}
+	if _, ok := vars[name]; ok {
+		errs = append(errs, fmt.Errorf("duplicate instances of variable name %q\npattern: %q", name, pattern))
+		return errs
+	}
+	return errs
+}
+
+func illegalChar(pattern, kind, chars string) error {
+	var s string
+	cc := strings.Split(chars, "")
+	for i, c := range cc {
+		if i == len(cc)-1 {
+			s += fmt.Sprintf(" or %q", c)
+			break
+		}
+		s += fmt.Sprintf("%q,", c)
+	}
+	return fmt.Errorf("pattern segment %s cannot contain %s\npattern: %q", kind, s, pattern)
+}
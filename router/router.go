@@ -2,13 +2,92 @@ package router
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+/*
+ResponseWriter is the concrete http.ResponseWriter every Handler
+is supplied by ServeHTTP. Middleware that needs to transform the
+response body (e.g. gzip compression) can call Wrap to install
+the writer its Write calls should go through instead of the
+underlying connection; Writer returns whatever is currently
+installed (the original connection if nothing has wrapped it
+yet), so a second middleware's Wrap composes with the first
+rather than discarding it.
+
+Middleware that needs to inspect or adjust headers (e.g.
+Content-Type) set by the route's handler, but can only do so
+before they are written to the underlying connection, should use
+OnWriteHeader rather than wrapping Header() directly: it is the
+only point, reachable whether the handler calls WriteHeader
+explicitly or just calls Write and gets an implicit 200, at which
+every header the handler is ever going to set has already been
+set.
+*/
+type ResponseWriter struct {
+	http.ResponseWriter
+	w        io.Writer
+	onHeader []func(status int)
+	wrote    bool
+}
+
+// Wrap installs w as the destination for subsequent calls to Write.
+func (rw *ResponseWriter) Wrap(w io.Writer) {
+	rw.w = w
+}
+
+// Writer returns the writer subsequent Write calls currently go
+// through, for a middleware that wants to wrap it in turn without
+// discarding whatever an earlier middleware already installed.
+func (rw *ResponseWriter) Writer() io.Writer {
+	return rw.w
+}
+
+/*
+OnWriteHeader registers fn to run, in registration order,
+immediately before the status code is written to the underlying
+connection — whether that happens because the handler called
+WriteHeader explicitly, or because its first call to Write
+implied a 200.
+*/
+func (rw *ResponseWriter) OnWriteHeader(fn func(status int)) {
+	rw.onHeader = append(rw.onHeader, fn)
+}
+
+func (rw *ResponseWriter) WriteHeader(status int) {
+	if rw.wrote {
+		rw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	rw.wrote = true
+	for _, fn := range rw.onHeader {
+		fn(status)
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *ResponseWriter) Write(b []byte) (int, error) {
+	if !rw.wrote {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.w.Write(b)
+}
+
+// Close closes the currently wrapped writer if it is an io.Closer,
+// e.g. a *gzip.Writer installed by a compression middleware.
+func (rw *ResponseWriter) Close() error {
+	if c, ok := rw.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 type Handler = func(w http.ResponseWriter, r *Request)
 type Guard = func(r *Request) bool
 type Vars = map[string]string
@@ -49,6 +128,17 @@ type Options = struct {
 	*/
 	Error Handler
 
+	/*
+		MethodNotAllowed is called, in place of Error, when a
+		request's path matches a registered pattern but no
+		route exists for its method. The Allow header will
+		already have been set to the list of methods the
+		pattern does accept by the time MethodNotAllowed runs.
+		If it is nil, Error is called instead with Status set
+		to 405.
+	*/
+	MethodNotAllowed Handler
+
 	/*
 		Recover will be called in the event of a panic. The
 		supplied *Request will count the error in its Error
@@ -74,150 +164,107 @@ type Options = struct {
 
 type Router struct {
 	route
-	opt       Options
-	reqId     uint64
-	reqIdMu   sync.Mutex
-	seenRoute map[string]struct{}
-	Errors    []error
+	opt     Options
+	reqId   uint64
+	reqIdMu sync.Mutex
+	root    *node
+	names   map[string]*routeEntry
+	entries []*routeEntry
+	Errors  []error
 }
 
 /*
-New returns an initialised *Router that is ready to have
-routes added to it. The returned *Router has an Errors
-field that will be populated with errors resulting from
-calls to its methods named after the HTTP verbs (Get, Pst,
-Put, etc.)
+RouteInfo describes a single registered route, as returned by
+Router.Routes. Name is empty unless Name was called on the
+route.
 */
-func New(o Options) *Router {
-	rt := &Router{}
-	rt.opt = o
-	rt.route.rt = rt
-	if rt.opt.IdGenerator == nil {
-		rt.opt.IdGenerator = defaultIdGen(rt)
-	}
-	return rt
-}
-
-type route struct {
-	method       string
-	pattern      []segment
-	route        []route
-	handler      Handler
-	use          Handler
-	skip         Guard
-	unauthorized Guard
-	rt           *Router
-}
-
-type segment struct {
-	raw     string
-	varName string
-	matches []string
+type RouteInfo struct {
+	Name    string
+	Method  string
+	Pattern string
 }
 
 /*
-Use can be placed among calls to the HTTP verb methods
-without affecting matches. Since it is supplied a pointer
-to Request, one use for this method could be to attach
-a user object to the User field of *Request.
-
-If an error is encountered during the call to handler the
-error must be assigned to the supplied *Request object's
-Error field and the appropriate HTTP status code to its
-Status field.
+Routes returns information about every route registered on
+rt, in registration order. It is intended for introspection
+and debug pages.
 */
-func (r *route) Use(handler Handler) {
-	rt := r.rt
-	if handler == nil {
-		rt.Errors = append(rt.Errors, fmt.Errorf(
-			"function supplied to Use is nil",
-		))
+func (rt *Router) Routes() []RouteInfo {
+	info := make([]RouteInfo, len(rt.entries))
+	for i, e := range rt.entries {
+		info[i] = RouteInfo{Name: e.name, Method: e.method, Pattern: e.pattern}
 	}
-	r.route = append(r.route, route{
-		use: handler,
-	})
+	return info
 }
 
 /*
-Group allows for groupings of routes.
-
-The return value of skip determines if this grouping will
-even be examined. If skip returns true the pattern matching
-check will completely skip over the grouped routes as though
-they don't exist. If skip returns false or is nil the patterns
-within the grouping will be checked as usual.
-
-The return value of unauthorized determines if the client has
-authorisation to visit this grouping. Assuming skip is nil
-or returns false, unauthorized always checks patterns for matches.
-If unauthorized returns true AND a pattern matches then the parent
-*Router Error will be called (if supplied) with the Status field
-of *Request set to 401 (i.e., Unauthorized).
+URL reconstructs the URL for the route registered under name,
+substituting vars into its variable segments. vars is a list
+of alternating variable name and value pairs, e.g.
+
+	rt.URL("user", "id", "42")
+
+It is an error if name isn't registered, if a required
+variable is missing, or if a supplied value doesn't satisfy
+that variable's whitelist or regex constraint.
 */
-func (r *route) Group(pattern string, skip, unauthorized Guard) *route {
-	rt := r.rt
-	group := route{
-		pattern:      rt.expandPattern(pattern),
-		skip:         skip,
-		unauthorized: unauthorized,
-		rt:           rt,
-	}
-	r.route = append(r.route, group)
-	return &r.route[len(r.route)-1]
-}
-func (r *route) Hed(pattern string, handler Handler) {
-	r.add("HEAD", pattern, handler)
-}
-func (r *route) Trc(pattern string, handler Handler) {
-	r.add("TRACE", pattern, handler)
-}
-func (r *route) Con(pattern string, handler Handler) {
-	r.add("CONNECT", pattern, handler)
-}
-func (r *route) Opt(pattern string, handler Handler) {
-	r.add("OPTIONS", pattern, handler)
-}
-func (r *route) Get(pattern string, handler Handler) {
-	r.add("GET", pattern, handler)
-}
-func (r *route) Pst(pattern string, handler Handler) {
-	r.add("POST", pattern, handler)
-}
-func (r *route) Put(pattern string, handler Handler) {
-	r.add("PUT", pattern, handler)
-}
-func (r *route) Pat(pattern string, handler Handler) {
-	r.add("PATCH", pattern, handler)
-}
-func (r *route) Del(pattern string, handler Handler) {
-	r.add("DELETE", pattern, handler)
-}
-func (r *route) add(method, pattern string, handler Handler) {
+func (rt *Router) URL(name string, vars ...string) (string, error) {
 
-	rt := r.rt
+	entry, ok := rt.names[name]
+	if !ok {
+		return "", fmt.Errorf("no route named %q", name)
+	}
+	if len(vars)%2 != 0 {
+		return "", fmt.Errorf("URL requires key/value pairs, got an odd number of arguments")
+	}
 
-	if handler == nil {
-		rt.Errors = append(rt.Errors, fmt.Errorf(
-			"no handler supplied for route %s %s",
-			method,
-			pattern,
-		))
+	supplied := make(map[string]string, len(vars)/2)
+	for i := 0; i < len(vars); i += 2 {
+		supplied[vars[i]] = vars[i+1]
 	}
 
-	if _, ok := rt.seenRoute[method+pattern]; ok {
-		rt.Errors = append(rt.Errors, fmt.Errorf(
-			"unreachable route due to duplicate method and pattern: %s %s",
-			method,
-			pattern,
-		))
+	var parts []string
+	for _, seg := range entry.segs {
+
+		if seg.varName == "" {
+			parts = append(parts, seg.matches[0])
+			continue
+		}
+
+		value, ok := supplied[seg.varName]
+		if !ok {
+			return "", fmt.Errorf("no value supplied for variable %q\npattern: %q", seg.varName, entry.pattern)
+		}
+
+		switch {
+		case seg.matches != nil && !in(seg.matches, value):
+			return "", fmt.Errorf("value %q is not permitted for variable %q\npattern: %q", value, seg.varName, entry.pattern)
+		case seg.re != nil && !seg.re.MatchString(value):
+			return "", fmt.Errorf("value %q does not satisfy the constraint on variable %q\npattern: %q", value, seg.varName, entry.pattern)
+		}
+
+		parts = append(parts, value)
 	}
 
-	r.route = append(r.route, route{
-		method:  method,
-		pattern: rt.expandPattern(pattern),
-		handler: handler,
-		rt:      rt,
-	})
+	return "/" + strings.Join(parts, "/"), nil
+}
+
+/*
+New returns an initialised *Router that is ready to have
+routes added to it. The returned *Router has an Errors
+field that will be populated with errors resulting from
+calls to its methods named after the HTTP verbs (Get, Pst,
+Put, etc.)
+*/
+func New(o Options) *Router {
+	rt := &Router{}
+	rt.opt = o
+	rt.root = &node{}
+	rt.route = route{rt: rt, n: rt.root}
+	if rt.opt.IdGenerator == nil {
+		rt.opt.IdGenerator = defaultIdGen(rt)
+	}
+	return rt
 }
 
 func defaultIdGen(rt *Router) func() string {
@@ -232,17 +279,22 @@ func defaultIdGen(rt *Router) func() string {
 
 func (rt *Router) ServeHTTP(w http.ResponseWriter, request *http.Request) {
 
+	rw := &ResponseWriter{ResponseWriter: w, w: w}
+
 	r := &Request{
 		Id:      rt.opt.IdGenerator(),
 		Request: request,
-		Vars:    make(Vars),
 		Began:   time.Now(),
 	}
 
 	if rt.opt.Deferred != nil {
-		defer rt.opt.Deferred(w, r)
+		defer rt.opt.Deferred(rw, r)
 	}
 
+	// Flushes and closes whatever writer middleware such as gzip
+	// compression may have installed on rw, before Deferred runs.
+	defer rw.Close()
+
 	/*
 		This is after the call to rt.Deferred call because they're
 		executed in reverse order. We need to call w.WriteHeader
@@ -252,237 +304,61 @@ func (rt *Router) ServeHTTP(w http.ResponseWriter, request *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
 				r.Error = fmt.Errorf("%v", rec)
-				rt.opt.Recover(w, r)
+				rt.opt.Recover(rw, r)
 			}
 		}()
 	}
 
 	if rt.opt.Before != nil {
-		rt.opt.Before(w, r)
+		rt.opt.Before(rw, r)
 		if r.Status >= 300 && r.Status < 400 {
 			return
 		}
 	}
 
 	reqPath := explodePath(request.URL.Path)
-	code, match := iterateRoutes(w, r, rt.route.route, reqPath, false)
+	bindings := make([]binding, 0, len(reqPath))
+	var allowed map[string]bool
+	code, match := matchNode(rw, r, rt.root, reqPath, bindings, false, &allowed)
 	if !match {
 		code = 404
+		if len(allowed) > 0 {
+			code = http.StatusMethodNotAllowed
+			rw.Header().Set("Allow", allowHeader(allowed))
+			if rt.opt.MethodNotAllowed != nil {
+				if r.Vars == nil {
+					r.Vars = make(Vars)
+				}
+				r.Status = code
+				rt.opt.MethodNotAllowed(rw, r)
+				return
+			}
+		}
 	}
 	if code >= 400 && rt.opt.Error != nil {
 		if r.Vars == nil {
 			r.Vars = make(Vars)
 		}
 		r.Status = code
-		rt.opt.Error(w, r)
+		rt.opt.Error(rw, r)
 		return
 	}
 }
 
-/*
-iterateRoutes recursively searches routes for the first match
-to reqPath.
-*/
-func iterateRoutes(
-	w http.ResponseWriter,
-	r *Request,
-	routes []route,
-	reqPath []string,
-	unauthorized bool,
-) (
-	code int,
-	match bool,
-) {
-	for _, route := range routes {
-		if route.use != nil {
-			route.use(w, r)
-			if r.Error != nil {
-				return r.Status, true
-			}
-			continue
-		}
-		if route.skip != nil && route.skip(r) {
-			continue
-		}
-		if route.method != "" && route.method != r.Request.Method {
-			continue
-		}
-		if len(route.pattern) > len(reqPath) {
-			continue
-		}
-		remainingPath := reqPath[len(route.pattern):]
-		vars, ok := pathsMatch(route.pattern, reqPath[:len(route.pattern)])
-		if !ok {
-			continue
-		}
-		r.Vars = vars
-		// Make a copy for this iteration so as to not affect sibling routes.
-		unauthorized := unauthorized
-		if route.unauthorized != nil && route.unauthorized(r) {
-			unauthorized = true
-		}
-		if len(remainingPath) == 0 {
-			if unauthorized {
-				return http.StatusUnauthorized, true
-			}
-			route.handler(w, r)
-			return 0, true
-		}
-		if len(route.route) > 0 {
-			c, m := iterateRoutes(w, r, route.route, remainingPath, unauthorized)
-			if m {
-				return c, m
-			}
-		}
-	}
-	return 0, false
-}
-
-func pathsMatch(pattern []segment, reqPath []string) (vars Vars, ok bool) {
-
-	vars = make(Vars)
-
-	if len(pattern) != len(reqPath) {
-		return nil, false
+// allowHeader builds the value of the Allow header from the
+// methods collected during matching, adding HEAD whenever GET
+// is present and OPTIONS unconditionally, per RFC 7231.
+func allowHeader(allowed map[string]bool) string {
+	if allowed["GET"] {
+		allowed["HEAD"] = true
 	}
-
-	for i, seg := range pattern {
-
-		// Wildcard segment.
-		if seg.matches == nil {
-			if seg.varName != "" {
-				vars[seg.varName] = reqPath[i]
-			}
-			continue
-		}
-
-		found := false
-		for _, match := range seg.matches {
-			if match == reqPath[i] {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return nil, false
-		}
-
-		if seg.varName != "" {
-			vars[seg.varName] = reqPath[i]
-		}
-	}
-
-	if len(vars) == 0 {
-		vars = nil
-	}
-
-	return vars, true
-}
-
-func (rt *Router) expandPattern(pattern string) []segment {
-
-	if pattern == "" {
-		return nil
-	}
-
-	var segments []segment
-	subPatterns := explodePath(pattern)
-	seenVars := make(map[string]bool)
-
-	for _, sp := range subPatterns {
-
-		var literal *string
-		var varName string
-		var matches []string
-		var listStart int
-		var errs []error
-		illegal := ":[]"
-
-		switch {
-
-		// Literal segment.
-		case sp[0] != ':' && sp[0] != '[':
-			if idx := strings.IndexAny(sp, illegal); idx != -1 {
-				errs = append(errs, illegalChar(pattern, "literal", illegal))
-			}
-			literal = &sp
-
-		// Segement with variable.
-		case sp[0] == ':':
-			listStart = strings.IndexRune(sp, '[')
-			if listStart == -1 {
-				varName = sp[1:]
-				errs = append(errs, validVarName(pattern, varName, seenVars)...)
-				seenVars[varName] = true
-				break
-			}
-			varName = sp[1:listStart]
-			errs = append(errs, validVarName(pattern, varName, seenVars)...)
-			seenVars[varName] = true
-			fallthrough
-
-		// Segment containing whitelist.
-		case sp[0] == '[':
-			if sp[len(sp)-1] != ']' {
-				errs = append(errs, fmt.Errorf(
-					`pattern segment contains "[" but doesn't end with "]"`+"\n"+
-						"pattern: %q", pattern))
-			}
-			matches = strings.Split(sp[listStart+1:len(sp)-1], ",")
-		}
-
-		if idx := strings.IndexAny(varName, illegal); idx != -1 {
-			errs = append(errs, illegalChar(pattern, "variable", illegal))
-		}
-		for i := range matches {
-			matches[i] = strings.TrimSpace(matches[i])
-			if idx := strings.IndexAny(matches[i], illegal); idx != -1 {
-				errs = append(errs, illegalChar(pattern, "whitelist", illegal))
-			}
-		}
-
-		if literal != nil {
-			matches = []string{*literal}
-		}
-
-		if len(errs) > 0 {
-			rt.Errors = append(rt.Errors, errs...)
-			continue
-		}
-
-		segments = append(segments, segment{
-			raw:     sp,
-			varName: varName,
-			matches: matches,
-		})
-	}
-
-	return segments
-}
-
-func validVarName(pattern, name string, vars map[string]bool) (errs []error) {
-	if name == "" {
-		errs = append(errs, fmt.Errorf(`no variable name after ":"\npattern: %q`, pattern))
-		return errs
-	}
-	if _, ok := vars[name]; ok {
-		errs = append(errs, fmt.Errorf("duplicate instances of variable name %q\npattern: %q", name, pattern))
-		return errs
-	}
-	return errs
-}
-
-func illegalChar(pattern, kind, chars string) error {
-	var s string
-	cc := strings.Split(chars, "")
-	for i, c := range cc {
-		if i == len(cc)-1 {
-			s += fmt.Sprintf(" or %q", c)
-			break
-		}
-		s += fmt.Sprintf("%q,", c)
+	allowed["OPTIONS"] = true
+	methods := make([]string, 0, len(allowed))
+	for method := range allowed {
+		methods = append(methods, method)
 	}
-	return fmt.Errorf("pattern segment %s cannot contain %s\npattern: %q", kind, s, pattern)
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
 }
 
 func in(ss []string, s string) bool {
@@ -0,0 +1,416 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+/*
+node is one position in the trie built up by repeated calls
+to Group and the HTTP verb methods. Each node stands for a
+single path segment; chains of single-child nodes are not
+merged into one edge. A node
+may have any number of literal children, at most one param
+child and at most one whitelist child. Literal children are
+tried first, then the whitelist, then the param, which gives
+static routes priority over variable ones with no further
+bookkeeping required.
+*/
+type node struct {
+	lit          map[string]*node
+	param        *paramEdge
+	whitelist    *whitelistEdge
+	wildcard     *wildcardEdge
+	routes       map[string]*routeEntry
+	mw           []Handler
+	skip         Guard
+	unauthorized Guard
+	hostSegs     []segment         // set by Host; nil means no Host constraint
+	schemes      map[string]bool   // set by Schemes; nil means no scheme constraint
+	headers      map[string]string // set by Headers; nil means no header constraint
+}
+
+/*
+routeEntry is a single registered method+pattern combination.
+It is stored both on the node it terminates at (for matching)
+and on the Router (for Name/URL/Routes introspection).
+*/
+type routeEntry struct {
+	method  string
+	name    string
+	pattern string
+	segs    []segment
+	handler Handler
+}
+
+// paramEdge is a ":name" child, optionally constrained by a
+// regular expression (":name{regex}").
+type paramEdge struct {
+	varName string
+	re      *regexp.Regexp
+	node    *node
+}
+
+// whitelistEdge is a ":name[a,b,c]" child.
+type whitelistEdge struct {
+	varName string
+	set     map[string]struct{}
+	node    *node
+}
+
+// wildcardEdge is a "*name" child that consumes the rest of
+// the path, however many segments remain.
+type wildcardEdge struct {
+	varName string
+	node    *node
+}
+
+// binding records a variable captured while descending the trie.
+type binding struct {
+	name  string
+	value string
+}
+
+/*
+insert walks n, creating a node for each segment not already
+present, so routes registered under the same parent share the
+nodes of their common leading segments; no edge is ever split
+or merged. It returns the node at the end of segs. Conflicting
+variable usage at the same position in the trie (two differently
+named params, or a param competing with a whitelist) is recorded
+on rt.Errors rather than returned, matching the error-accumulation
+style of expandPattern. A param/whitelist pair only conflicts when
+the param's regex (if any) could actually produce one of the
+whitelist's values; a regex-constrained param disjoint from the
+whitelist's values, e.g. :id{^[0-9]+$} alongside
+:status[active,archived], is not a conflict.
+*/
+func (rt *Router) insert(n *node, segs []segment, pattern string) *node {
+	cur := n
+	for _, seg := range segs {
+		switch {
+
+		// Catch-all tail segment.
+		case seg.wildcard:
+			if cur.wildcard == nil {
+				cur.wildcard = &wildcardEdge{varName: seg.varName, node: &node{}}
+			} else if cur.wildcard.varName != seg.varName {
+				rt.Errors = append(rt.Errors, fmt.Errorf(
+					"catch-all variable %q conflicts with variable %q at the same position\npattern: %q",
+					seg.varName, cur.wildcard.varName, pattern,
+				))
+			}
+			cur = cur.wildcard.node
+
+		// Literal segment.
+		case seg.varName == "" && len(seg.matches) == 1:
+			lit := seg.matches[0]
+			if cur.lit == nil {
+				cur.lit = make(map[string]*node)
+			}
+			child, ok := cur.lit[lit]
+			if !ok {
+				child = &node{}
+				cur.lit[lit] = child
+			}
+			cur = child
+
+		// Segment with a whitelist.
+		case seg.matches != nil:
+			if cur.param != nil && regexOverlapsAny(cur.param.re, seg.matches) {
+				rt.Errors = append(rt.Errors, fmt.Errorf(
+					"variable %q with a whitelist may match the same value as variable %q\npattern: %q",
+					seg.varName, cur.param.varName, pattern,
+				))
+			}
+			if cur.whitelist == nil {
+				cur.whitelist = &whitelistEdge{
+					varName: seg.varName,
+					set:     make(map[string]struct{}),
+					node:    &node{},
+				}
+			} else if cur.whitelist.varName != seg.varName {
+				rt.Errors = append(rt.Errors, fmt.Errorf(
+					"variable %q conflicts with variable %q at the same position\npattern: %q",
+					seg.varName, cur.whitelist.varName, pattern,
+				))
+			}
+			for _, m := range seg.matches {
+				cur.whitelist.set[m] = struct{}{}
+			}
+			cur = cur.whitelist.node
+
+		// Variable segment, optionally constrained by a regex.
+		default:
+			if cur.whitelist != nil && regexOverlapsSet(seg.re, cur.whitelist.set) {
+				rt.Errors = append(rt.Errors, fmt.Errorf(
+					"variable %q may match the same value as whitelisted variable %q\npattern: %q",
+					seg.varName, cur.whitelist.varName, pattern,
+				))
+			}
+			if cur.param == nil {
+				cur.param = &paramEdge{varName: seg.varName, re: seg.re, node: &node{}}
+			} else if cur.param.varName != seg.varName || !sameRegex(cur.param.re, seg.re) {
+				rt.Errors = append(rt.Errors, fmt.Errorf(
+					"variable %q conflicts with variable %q at the same position\npattern: %q",
+					seg.varName, cur.param.varName, pattern,
+				))
+			}
+			cur = cur.param.node
+		}
+	}
+	return cur
+}
+
+/*
+matchNode descends the trie one path segment at a time. At each
+node it passes through, skip, Schemes, Headers, and Host are all
+checked before that node's own Use middleware runs, so that a
+grouping whose matchers reject the request is treated as though
+it, and everything registered under it including its own Use
+middleware, doesn't exist — the same "falls through like a path
+mismatch" behaviour documented on Host/Schemes/Headers extends to
+not invoking mw. bindings is reused across sibling attempts; it
+is only turned into the *Request's Vars map once the request is
+settled at a node: its handler is about to run, the unauthorized
+guard has rejected it, or a Use middleware has ended it.
+
+allowed collects, by side effect, every method found registered
+against a node whose full pattern otherwise matched the request
+path. ServeHTTP uses it to tell a 404 (no pattern matched) apart
+from a 405 (a pattern matched, but not for this method). It is a
+pointer to a possibly-nil map so the common case, a request that
+does match, never allocates one.
+*/
+func matchNode(
+	w http.ResponseWriter,
+	r *Request,
+	n *node,
+	reqPath []string,
+	bindings []binding,
+	unauthorized bool,
+	allowed *map[string]bool,
+) (code int, match bool) {
+
+	if n.skip != nil && n.skip(r) {
+		return 0, false
+	}
+
+	if n.schemes != nil && !n.schemes[requestScheme(r.Request)] {
+		return 0, false
+	}
+
+	if n.headers != nil {
+		for k, v := range n.headers {
+			if r.Request.Header.Get(k) != v {
+				return 0, false
+			}
+		}
+	}
+
+	if n.hostSegs != nil {
+		b, ok := matchHost(n.hostSegs, r.Request.Host)
+		if !ok {
+			return 0, false
+		}
+		bindings = append(bindings, b...)
+	}
+
+	for _, use := range n.mw {
+		use(w, r)
+		if r.Error != nil {
+			applyBindings(r, bindings)
+			return r.Status, true
+		}
+		// A 2xx/3xx Status set by Use means the middleware has
+		// already written the response itself (e.g. a CORS
+		// preflight reply or a redirect) and the request is done.
+		if r.Status >= 200 && r.Status < 400 {
+			applyBindings(r, bindings)
+			return 0, true
+		}
+	}
+
+	if n.unauthorized != nil && n.unauthorized(r) {
+		unauthorized = true
+	}
+
+	if len(reqPath) == 0 {
+		if entry, ok := n.routes[r.Request.Method]; ok {
+			applyBindings(r, bindings)
+			if unauthorized {
+				return http.StatusUnauthorized, true
+			}
+			entry.handler(w, r)
+			return 0, true
+		}
+		for method := range n.routes {
+			if *allowed == nil {
+				*allowed = make(map[string]bool)
+			}
+			(*allowed)[method] = true
+		}
+		if n.wildcard != nil {
+			b := append(bindings, binding{n.wildcard.varName, ""})
+			if code, match := matchNode(w, r, n.wildcard.node, nil, b, unauthorized, allowed); match {
+				return code, match
+			}
+		}
+		return 0, false
+	}
+
+	seg, rest := reqPath[0], reqPath[1:]
+
+	if child, ok := n.lit[seg]; ok {
+		if code, match := matchNode(w, r, child, rest, bindings, unauthorized, allowed); match {
+			return code, match
+		}
+	}
+
+	if n.whitelist != nil {
+		if _, ok := n.whitelist.set[seg]; ok {
+			b := append(bindings, binding{n.whitelist.varName, seg})
+			if code, match := matchNode(w, r, n.whitelist.node, rest, b, unauthorized, allowed); match {
+				return code, match
+			}
+		}
+	}
+
+	if n.param != nil && (n.param.re == nil || n.param.re.MatchString(seg)) {
+		b := append(bindings, binding{n.param.varName, seg})
+		if code, match := matchNode(w, r, n.param.node, rest, b, unauthorized, allowed); match {
+			return code, match
+		}
+	}
+
+	if n.wildcard != nil {
+		b := append(bindings, binding{n.wildcard.varName, strings.Join(reqPath, "/")})
+		if code, match := matchNode(w, r, n.wildcard.node, nil, b, unauthorized, allowed); match {
+			return code, match
+		}
+	}
+
+	return 0, false
+}
+
+/*
+matchHost matches the labels of host (the request's Host header,
+with any port stripped) against segs, the segments produced by
+expandHostPattern. It mirrors matchNode's per-segment handling of
+literals, whitelists, regex-constrained and plain variables, and
+a trailing wildcard, but does so linearly rather than through the
+trie since a Host pattern is a single fixed matcher on one node.
+*/
+func matchHost(segs []segment, host string) (bindings []binding, ok bool) {
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	labels := strings.Split(host, ".")
+
+	i := 0
+	for _, seg := range segs {
+
+		if seg.wildcard {
+			bindings = append(bindings, binding{seg.varName, strings.Join(labels[i:], ".")})
+			i = len(labels)
+			break
+		}
+
+		if i >= len(labels) {
+			return nil, false
+		}
+		label := labels[i]
+		i++
+
+		switch {
+		case seg.varName == "" && len(seg.matches) == 1:
+			if label != seg.matches[0] {
+				return nil, false
+			}
+		case seg.re != nil:
+			if !seg.re.MatchString(label) {
+				return nil, false
+			}
+			bindings = append(bindings, binding{seg.varName, label})
+		case seg.matches != nil:
+			if !in(seg.matches, label) {
+				return nil, false
+			}
+			bindings = append(bindings, binding{seg.varName, label})
+		default:
+			bindings = append(bindings, binding{seg.varName, label})
+		}
+	}
+
+	if i != len(labels) {
+		return nil, false
+	}
+
+	return bindings, true
+}
+
+// requestScheme reports the scheme a request arrived over,
+// trusting X-Forwarded-Proto when set since r.TLS is nil for
+// requests terminated upstream of a TLS-handling proxy.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if scheme := r.Header.Get("X-Forwarded-Proto"); scheme != "" {
+		return strings.ToLower(scheme)
+	}
+	return "http"
+}
+
+// regexOverlapsAny reports whether re could match one of values,
+// treating a nil (unconstrained) re as overlapping everything.
+func regexOverlapsAny(re *regexp.Regexp, values []string) bool {
+	if re == nil {
+		return true
+	}
+	for _, v := range values {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// regexOverlapsSet is regexOverlapsAny for a whitelist's set
+// representation.
+func regexOverlapsSet(re *regexp.Regexp, set map[string]struct{}) bool {
+	if re == nil {
+		return true
+	}
+	for v := range set {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameRegex(a, b *regexp.Regexp) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.String() == b.String()
+}
+
+func applyBindings(r *Request, bindings []binding) {
+	if len(bindings) == 0 {
+		return
+	}
+	r.Vars = make(Vars, len(bindings))
+	for _, b := range bindings {
+		// A whitelist with no variable name binds nothing.
+		if b.name == "" {
+			continue
+		}
+		r.Vars[b.name] = b.value
+	}
+}
@@ -0,0 +1,257 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(rt *Router, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	rt.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMatchPrecedence(t *testing.T) {
+
+	var got string
+
+	rt := New(Options{})
+	rt.Get("/users/me", func(w http.ResponseWriter, r *Request) {
+		got = "literal"
+	})
+	rt.Get("/users/:status[me,all]", func(w http.ResponseWriter, r *Request) {
+		got = "whitelist:" + r.Vars["status"]
+	})
+	rt.Get(`/users/:id{^[0-9]+$}`, func(w http.ResponseWriter, r *Request) {
+		got = "param:" + r.Vars["id"]
+	})
+
+	if len(rt.Errors) > 0 {
+		t.Fatalf("unexpected errors registering routes: %v", rt.Errors)
+	}
+
+	// A literal child is tried before the whitelist or param
+	// siblings registered at the same position.
+	serve(rt, "GET", "/users/me")
+	if got != "literal" {
+		t.Errorf("got %q, want %q", got, "literal")
+	}
+
+	// The whitelist is tried before the regex-constrained param.
+	serve(rt, "GET", "/users/all")
+	if got != "whitelist:all" {
+		t.Errorf("got %q, want %q", got, "whitelist:all")
+	}
+
+	serve(rt, "GET", "/users/42")
+	if got != "param:42" {
+		t.Errorf("got %q, want %q", got, "param:42")
+	}
+}
+
+func TestWhitelistParamConflict(t *testing.T) {
+	rt := New(Options{})
+	rt.Get("/items/:id", func(w http.ResponseWriter, r *Request) {})
+	rt.Get("/items/:status[active,archived]", func(w http.ResponseWriter, r *Request) {})
+
+	if len(rt.Errors) == 0 {
+		t.Fatal("expected an error for an unconstrained param conflicting with a whitelist, got none")
+	}
+}
+
+func TestRegexWhitelistNoConflictWhenDisjoint(t *testing.T) {
+	rt := New(Options{})
+	rt.Get(`/items/:id{^[0-9]+$}`, func(w http.ResponseWriter, r *Request) {})
+	rt.Get("/items/:status[active,archived]", func(w http.ResponseWriter, r *Request) {})
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("expected no error for a regex disjoint from the whitelist's values, got: %v", rt.Errors)
+	}
+}
+
+func TestRegexWhitelistConflictWhenOverlapping(t *testing.T) {
+	rt := New(Options{})
+	rt.Get(`/items/:id{^[a-z]+$}`, func(w http.ResponseWriter, r *Request) {})
+	rt.Get("/items/:status[active,archived]", func(w http.ResponseWriter, r *Request) {})
+
+	if len(rt.Errors) == 0 {
+		t.Fatal("expected an error for a regex that could match one of the whitelist's values, got none")
+	}
+}
+
+func TestGroupNilGuardKeepsExisting(t *testing.T) {
+
+	authCalls := 0
+	auth := func(r *Request) bool {
+		authCalls++
+		return true
+	}
+
+	rt := New(Options{Error: func(w http.ResponseWriter, r *Request) {
+		w.WriteHeader(r.Status)
+	}})
+
+	g := rt.Group("/admin", nil, auth)
+	g.Get("/dashboard", func(w http.ResponseWriter, r *Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Registering the group again from elsewhere with nil guards
+	// must not clear the guard already set.
+	g2 := rt.Group("/admin", nil, nil)
+	g2.Get("/reports", func(w http.ResponseWriter, r *Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", rt.Errors)
+	}
+
+	rec := serve(rt, "GET", "/admin/reports")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d: the unauthorized guard from the first Group call was lost", rec.Code, http.StatusUnauthorized)
+	}
+	if authCalls == 0 {
+		t.Error("unauthorized guard was never invoked")
+	}
+}
+
+func TestWildcardCatchAll(t *testing.T) {
+
+	var got string
+
+	rt := New(Options{})
+	rt.Get("/assets/*path", func(w http.ResponseWriter, r *Request) {
+		got = r.Vars["path"]
+	})
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("unexpected errors registering routes: %v", rt.Errors)
+	}
+
+	serve(rt, "GET", "/assets/css/site.css")
+	if got != "css/site.css" {
+		t.Errorf("got %q, want %q", got, "css/site.css")
+	}
+
+	serve(rt, "GET", "/assets")
+	if got != "" {
+		t.Errorf("got %q, want %q", got, "")
+	}
+}
+
+func TestWildcardLosesToMoreSpecificSibling(t *testing.T) {
+
+	var got string
+
+	rt := New(Options{})
+	rt.Get("/assets/logo.png", func(w http.ResponseWriter, r *Request) {
+		got = "literal"
+	})
+	rt.Get("/assets/*path", func(w http.ResponseWriter, r *Request) {
+		got = "wildcard:" + r.Vars["path"]
+	})
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("unexpected errors registering routes: %v", rt.Errors)
+	}
+
+	serve(rt, "GET", "/assets/logo.png")
+	if got != "literal" {
+		t.Errorf("got %q, want %q", got, "literal")
+	}
+
+	serve(rt, "GET", "/assets/other.png")
+	if got != "wildcard:other.png" {
+		t.Errorf("got %q, want %q", got, "wildcard:other.png")
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+
+	rt := New(Options{Error: func(w http.ResponseWriter, r *Request) {
+		w.WriteHeader(r.Status)
+	}})
+	rt.Get("/items", func(w http.ResponseWriter, r *Request) {})
+	rt.Pst("/items", func(w http.ResponseWriter, r *Request) {})
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("unexpected errors registering routes: %v", rt.Errors)
+	}
+
+	rec := serve(rt, "DELETE", "/items")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	allow := rec.Header().Get("Allow")
+	for _, method := range []string{"GET", "POST", "HEAD", "OPTIONS"} {
+		if !strings.Contains(allow, method) {
+			t.Errorf("Allow header %q missing %q", allow, method)
+		}
+	}
+}
+
+func TestMethodNotAllowedCustomHandler(t *testing.T) {
+
+	called := false
+	rt := New(Options{
+		MethodNotAllowed: func(w http.ResponseWriter, r *Request) {
+			called = true
+			w.WriteHeader(r.Status)
+		},
+	})
+	rt.Get("/items", func(w http.ResponseWriter, r *Request) {})
+
+	rec := serve(rt, "POST", "/items")
+	if !called {
+		t.Fatal("MethodNotAllowed was not invoked")
+	}
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestNotFoundDoesNotSetAllow(t *testing.T) {
+	rt := New(Options{})
+	rt.Get("/items", func(w http.ResponseWriter, r *Request) {})
+
+	rec := serve(rt, "GET", "/nope")
+	if got := rec.Header().Get("Allow"); got != "" {
+		t.Errorf("Allow header set to %q on a 404, want unset", got)
+	}
+}
+
+func TestSkipExcludesOwnMiddleware(t *testing.T) {
+
+	mwCalled := false
+
+	rt := New(Options{})
+	g := rt.Group("/beta", func(r *Request) bool { return true }, nil)
+	g.Use(func(w http.ResponseWriter, r *Request) {
+		mwCalled = true
+	})
+	g.Get("/feature", func(w http.ResponseWriter, r *Request) {})
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("unexpected errors registering routes: %v", rt.Errors)
+	}
+
+	serve(rt, "GET", "/beta/feature")
+	if mwCalled {
+		t.Error("Use middleware ran even though skip returned true for the grouping")
+	}
+}
+
+func TestGroupConflictingGuardsDetected(t *testing.T) {
+	rt := New(Options{})
+	rt.Group("/admin", nil, func(r *Request) bool { return true })
+	rt.Group("/admin", nil, func(r *Request) bool { return false })
+
+	if len(rt.Errors) == 0 {
+		t.Fatal("expected an error for two different unauthorized guards registered on the same grouping, got none")
+	}
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	rt := New(Options{})
+	rt.Get(`/users/:id{^[0-9]+$}/posts/:slug`, func(w http.ResponseWriter, r *Request) {}).Name("user-post")
+
+	if len(rt.Errors) != 0 {
+		t.Fatalf("unexpected errors registering routes: %v", rt.Errors)
+	}
+
+	got, err := rt.URL("user-post", "id", "42", "slug", "hello-world")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "/users/42/posts/hello-world"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestURLUnknownName(t *testing.T) {
+	rt := New(Options{})
+	if _, err := rt.URL("nope"); err == nil {
+		t.Fatal("expected an error for an unregistered route name, got none")
+	}
+}
+
+func TestURLMissingVar(t *testing.T) {
+	rt := New(Options{})
+	rt.Get("/users/:id", func(w http.ResponseWriter, r *Request) {}).Name("user")
+
+	if _, err := rt.URL("user"); err == nil {
+		t.Fatal("expected an error for a missing required variable, got none")
+	}
+}
+
+func TestURLConstraintViolation(t *testing.T) {
+	rt := New(Options{})
+	rt.Get(`/users/:id{^[0-9]+$}`, func(w http.ResponseWriter, r *Request) {}).Name("user")
+	rt.Get("/statuses/:status[active,archived]", func(w http.ResponseWriter, r *Request) {}).Name("status")
+
+	if _, err := rt.URL("user", "id", "not-a-number"); err == nil {
+		t.Error("expected an error for a value that fails the variable's regex constraint, got none")
+	}
+	if _, err := rt.URL("status", "status", "deleted"); err == nil {
+		t.Error("expected an error for a value not in the variable's whitelist, got none")
+	}
+}
+
+func TestDuplicateRouteName(t *testing.T) {
+	rt := New(Options{})
+	rt.Get("/a", func(w http.ResponseWriter, r *Request) {}).Name("dup")
+	rt.Get("/b", func(w http.ResponseWriter, r *Request) {}).Name("dup")
+
+	if len(rt.Errors) == 0 {
+		t.Fatal("expected an error registering a duplicate route name, got none")
+	}
+}